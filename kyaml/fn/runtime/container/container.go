@@ -4,21 +4,42 @@
 package container
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+	k8syaml "sigs.k8s.io/yaml"
 
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	runtimeexec "sigs.k8s.io/kustomize/kyaml/fn/runtime/exec"
 	"sigs.k8s.io/kustomize/kyaml/fn/runtime/runtimeutil"
+	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+// nativeKubernetesBackoff bounds how long the native kubernetes executor
+// retries pod creation and attach before giving up. Every error is retried,
+// transient (ImagePullBackOff, API server 5xxs) or not.
+const nativeKubernetesBackoff = 2 * time.Minute
+
 // Filter filters Resources using a container image.
 // The container must start a process that reads the list of
 // input Resources from stdin, reads the Configuration from the env
@@ -136,11 +157,90 @@ import (
 //	        ├── deployment_foo.yaml
 //	        └── service_bar.yaml
 type Filter struct {
-	runtimeutil.ContainerSpec `json:",inline" yaml:",inline"`
+	ClientV1Alpha1 `json:",inline" yaml:",inline"`
 
 	Exec runtimeexec.Filter
+}
+
+// Driver names the executor used to run the function container.
+type Driver string
+
+const (
+	// DriverDocker runs the function container with the docker CLI.
+	DriverDocker Driver = "docker"
+	// DriverPodman runs the function container with the podman CLI, for
+	// hosts that don't run a docker daemon (e.g. rootless podman hosts).
+	DriverPodman Driver = "podman"
+	// DriverKubectl runs the function container as a Pod, through client-go
+	// when a kubeconfig / in-cluster config is reachable and through the
+	// kubectl CLI otherwise.
+	DriverKubectl Driver = "kubectl"
+)
+
+// ClientV1Alpha1 is the versioned container execution spec consumed by a
+// ContainerDriver. Keeping it distinct from runtimeutil.ContainerSpec lets
+// the contract between Filter and its drivers grow (image pull secrets,
+// sinkOutputDir, envFrom, ...) without breaking existing driver
+// implementations or Filter's exported surface.
+type ClientV1Alpha1 struct {
+	runtimeutil.ContainerSpec `json:",inline" yaml:",inline"`
 
 	UIDGID string
+
+	// Driver selects the executor used to spawn the function container.
+	// Defaults to DriverDocker. DriverKubectl is also implied by
+	// ContainerSpec.EnableKubernetes for backwards compatibility.
+	Driver Driver
+
+	// Namespace is the namespace the function Pod is created in when run
+	// through a kubernetes driver. Defaults to "default". When it is unset,
+	// the kubectl-shell driver passes no --namespace (kubectl's current
+	// context decides) unless it auto-created a pull secret from
+	// DockerConfigPath, in which case it uses "default".
+	Namespace string
+
+	// ServiceAccountName is the service account the function Pod runs as
+	// when run through a kubernetes driver.
+	ServiceAccountName string
+
+	// ImagePullSecrets are the names of the secrets used to pull the
+	// function image when run through a kubernetes driver.
+	ImagePullSecrets []string
+
+	// NodeSelector constrains the function Pod to nodes with matching
+	// labels when run through a kubernetes driver.
+	NodeSelector map[string]string
+
+	// PullPolicy is the function Pod's imagePullPolicy when run through a
+	// kubernetes driver. The docker and podman drivers use it to decide
+	// whether to pull the image before running it (default IfNotPresent).
+	PullPolicy string
+
+	// PodTemplate is an inline Pod YAML manifest, or a path to one, used as
+	// the base Pod spec for a kubernetes driver. This lets users set things
+	// like resource limits, tolerations, affinity, initContainers, sidecars,
+	// or a serviceAccount that kustomize itself has no opinion on. The
+	// function container (image, stdin, env, and StorageMounts-derived
+	// volumeMounts) is merged into the container named "krm-function"; the
+	// template must contain exactly one such container and must not set
+	// restartPolicy to anything other than Never.
+	PodTemplate string
+
+	// DockerConfigPath is the path to a docker config.json (or equivalent)
+	// used for registry authentication. The docker and podman drivers pass
+	// it via --config; the kubernetes drivers use its contents to
+	// auto-create an imagePullSecrets entry when ImagePullSecrets is empty.
+	DockerConfigPath string
+
+	// Offline fails the run fast with a clear error if the image isn't
+	// already present locally, rather than attempting a network pull, so
+	// kustomize builds in air-gapped CI environments fail deterministically.
+	// The docker and podman drivers check for the image before running the
+	// container. The kubernetes drivers only set the Pod's imagePullPolicy
+	// to Never; the kubernetes-native driver retries the resulting
+	// ErrImageNeverPull like any other error until nativeKubernetesBackoff
+	// elapses.
+	Offline bool
 }
 
 func (c Filter) String() string {
@@ -154,41 +254,108 @@ func (c Filter) GetExit() error {
 }
 
 func (c *Filter) Filter(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
-	if err := c.setupExec(); err != nil {
+	driver, err := lookupDriver(c.driverName())
+	if err != nil {
 		return nil, err
 	}
-	return c.Exec.Filter(nodes)
+	if err := driver.Validate(c.ClientV1Alpha1); err != nil {
+		return nil, err
+	}
+	return driver.Run(context.Background(), c.ClientV1Alpha1, nodes)
 }
 
-func (c *Filter) setupExec() error {
-	// don't init 2x
-	if c.Exec.Path != "" {
-		return nil
+// driverName resolves the ContainerDriver to use. DriverKubectl and
+// ContainerSpec.EnableKubernetes are both kept as aliases for "a kubernetes
+// driver": they prefer talking to the cluster directly over shelling out to
+// kubectl, falling back to the kubectl shell-out when no kubeconfig /
+// in-cluster config is reachable. Neither is registered under its own name
+// in driverRegistry, so they must be translated here rather than passed
+// through verbatim.
+func (c *Filter) driverName() string {
+	if c.Driver != "" && c.Driver != DriverKubectl {
+		return string(c.Driver)
 	}
-
-	if c.Exec.WorkingDir == "" {
-		wd, err := os.Getwd()
-		if err != nil {
-			return errors.Wrap(err)
+	if c.Driver == DriverKubectl || c.ContainerSpec.EnableKubernetes {
+		if _, err := nativeKubernetesConfig(); err == nil {
+			return "kubernetes-native"
 		}
-		c.Exec.WorkingDir = wd
+		return "kubectl-shell"
 	}
+	return string(DriverDocker)
+}
 
-	path, args := c.getCommand()
-	c.Exec.Path = path
-	c.Exec.Args = args
-	return nil
+// nativeKubernetesConfig returns the rest.Config to use for the native
+// kubernetes executor, preferring KUBECONFIG / the default kubeconfig
+// location and falling back to in-cluster config.
+func nativeKubernetesConfig() (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err == nil {
+		return cfg, nil
+	}
+	return rest.InClusterConfig()
 }
 
-// getCommand returns the command + args to run to spawn the container
-func (c *Filter) getCommand() (string, []string) {
-	// if EnableKubernetes is true, use kubectl to run the container
-	if c.ContainerSpec.EnableKubernetes {
-		return c.getKubernetesCommand()
+// runExec spawns the container using getCommand and streams nodes through
+// it, used by the process-based drivers (docker, podman, kubectl-shell).
+func (c *Filter) runExec(getCommand func() (string, []string), nodes []*yaml.RNode) ([]*yaml.RNode, error) {
+	// don't init 2x
+	if c.Exec.Path == "" {
+		if c.Exec.WorkingDir == "" {
+			wd, err := os.Getwd()
+			if err != nil {
+				return nil, errors.Wrap(err)
+			}
+			c.Exec.WorkingDir = wd
+		}
+
+		path, args := getCommand()
+		c.Exec.Path = path
+		c.Exec.Args = args
+	}
+	return c.Exec.Filter(nodes)
+}
+
+// ensureImage makes sure bin ("docker" or "podman") has the function image
+// available locally according to PullPolicy before the container is run,
+// authenticating against DockerConfigPath if set and failing fast rather
+// than pulling when Offline is true.
+func (c *Filter) ensureImage(ctx context.Context, bin string) error {
+	policy := c.PullPolicy
+	if c.Offline {
+		policy = string(corev1.PullNever)
+	}
+	if policy == "" {
+		policy = string(corev1.PullIfNotPresent)
 	}
 
-	// otherwise use docker
-	return c.getDockerCommand()
+	present := exec.CommandContext(ctx, bin, "image", "inspect", c.Image).Run() == nil
+	if policy == string(corev1.PullNever) || (policy == string(corev1.PullIfNotPresent) && present) {
+		if present {
+			return nil
+		}
+		if c.Offline {
+			return errors.Errorf("offline mode: image %q is not present locally", c.Image)
+		}
+		return errors.Errorf("image %q is not present locally and PullPolicy is %s", c.Image, policy)
+	}
+
+	args := []string{"pull"}
+	if c.DockerConfigPath != "" {
+		args = append(args, "--config", c.DockerConfigPath)
+	}
+	args = append(args, c.Image)
+	pull := exec.CommandContext(ctx, bin, args...)
+	pull.Stdout = os.Stderr
+	pull.Stderr = os.Stderr
+	if err := pull.Run(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
 }
 
 // getDockerCommand returns the command + args to run to spawn the container in docker
@@ -224,119 +391,476 @@ func (c *Filter) getDockerCommand() (string, []string) {
 	return "docker", a
 }
 
+// getPodmanCommand returns the command + args to run to spawn the container in podman
+func (c *Filter) getPodmanCommand() (string, []string) {
+	network := runtimeutil.NetworkNameNone
+	if c.ContainerSpec.Network {
+		network = runtimeutil.NetworkNameHost
+	}
+
+	// run the container using podman. mirrors getDockerCommand, except that
+	// rootless podman needs an explicit userns mapping for the "nobody" user
+	// to be writable.
+	args := []string{"run",
+		"--rm",                                              // delete the container afterward
+		"-i", "-a", "STDIN", "-a", "STDOUT", "-a", "STDERR", // attach stdin, stdout, stderr
+		"--network", string(network),
+
+		// added security options
+		"--user", c.UIDGID,
+		"--security-opt=no-new-privileges", // don't allow the user to escalate privileges
+		// note: don't make fs readonly because things like heredoc rely on writing tmp files
+	}
+
+	if c.UIDGID == "nobody" {
+		args = append(args, "--userns=keep-id")
+	}
+
+	for _, storageMount := range c.StorageMounts {
+		// convert declarative relative paths to absolute (otherwise podman will throw an error)
+		if !filepath.IsAbs(storageMount.Src) {
+			storageMount.Src = filepath.Join(c.Exec.WorkingDir, storageMount.Src)
+		}
+		// storageMount.String() already produces podman's type=,source=,target=
+		// syntax (with a trailing ,readonly when ReadWriteMode is false) -
+		// reuse it instead of hand-rolling the flags so read-only mounts
+		// aren't silently dropped here the way docker's --mount honors them.
+		args = append(args, "--mount", storageMount.String())
+	}
+
+	args = append(args, runtimeutil.NewContainerEnvFromStringSlice(c.Env).GetDockerFlags()...)
+	a := append(args, c.Image) //nolint:gocritic
+	return "podman", a
+}
+
 // getKubernetesCommand returns the command + args to run to spawn the container in kubernetes
 func (c *Filter) getKubernetesCommand() (string, []string) {
-	// Use the image name as the pod name
 	podName := strings.Split(path.Base(c.Image), ":")[0]
 
-	// Define envs
-	envs := []map[string]interface{}{}
-	for k, v := range runtimeutil.NewContainerEnvFromStringSlice(c.Env).EnvVars {
-		envs = append(envs, map[string]interface{}{
-			"name":  k,
-			"value": v,
-		})
-	}
-
-	// Convert envs to JSON
-	envsJSON, _ := json.Marshal(envs)
-
-	// Handle UID and GID, default to 65534 (nobody) if c.UIDGID is "nobody"
-	uid := "65534"
-	gid := "65534"
-	if c.UIDGID != "nobody" && c.UIDGID != "" {
-		uidgid := strings.Split(c.UIDGID, ":")
-		if len(uidgid) == 2 {
-			uid = uidgid[0]
-			gid = uidgid[1]
+	// ContainerDriver.Validate rejects an invalid PodTemplate before Run is
+	// called, so buildPod is expected to succeed here.
+	pod, _ := c.buildPod()
+
+	// Only apiVersion and spec go into kubectl run --overrides, rather than
+	// the whole typed Pod object.
+	overrides, _ := json.Marshal(struct {
+		APIVersion string         `json:"apiVersion"`
+		Spec       corev1.PodSpec `json:"spec"`
+	}{APIVersion: "v1", Spec: pod.Spec})
+
+	args := []string{"run", podName,
+		"--rm", "--stdin", "--quiet", // Automatically remove the pod, attach stdin, and suppress output
+		"--image", c.Image, // Specify the container image
+		"--restart=Never", // Do not restart the pod
+		"--overrides", string(overrides),
+	}
+	// Without an explicit --namespace, kubectl falls back to the active
+	// context's default namespace, which may not match c.Namespace - and
+	// addAutoImagePullSecret creates the DockerConfigPath-derived pull
+	// secret in c.Namespace, so a mismatch here means the pod can't find it.
+	if c.Namespace != "" {
+		args = append(args, "--namespace", c.Namespace)
+	}
+	return "kubectl", args
+}
+
+// filterNative runs the function container as a Pod using client-go directly,
+// rather than shelling out to kubectl. It creates the Pod, waits for it to
+// start running, attaches to it to stream the Resources in over stdin and
+// read the filtered Resources back from stdout, and deletes the Pod once
+// done. Pod creation and attach are retried with exponential backoff to
+// absorb ImagePullBackOff and transient API server errors.
+func (c *Filter) filterNative(ctx context.Context, cfg *rest.Config, nodes []*yaml.RNode) ([]*yaml.RNode, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	in := &bytes.Buffer{}
+	if err := (kio.ByteWriter{Writer: in}).Write(nodes); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	// buildPod resolves relative StorageMount.Src against c.Exec.WorkingDir,
+	// which runExec would normally populate - filterNative bypasses runExec
+	// entirely, so it must set WorkingDir itself or relative mounts resolve
+	// against "" instead of the real working directory.
+	if c.Exec.WorkingDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		c.Exec.WorkingDir = wd
+	}
+
+	pod, err := c.buildPod()
+	if err != nil {
+		return nil, err
+	}
+	pullSecret, err := c.ensureImagePullSecret(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if pullSecret != "" {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: pullSecret})
+	}
+	pods := clientset.CoreV1().Pods(namespace)
+
+	// Each retry attempt creates a new Pod (GenerateName means a retried
+	// Create can't just reuse the prior name), so the previous attempt's
+	// Pod must be deleted before or after each retry - never left behind.
+	var created *corev1.Pod
+	err = retryWithBackoff(ctx, nativeKubernetesBackoff, func() error {
+		if created != nil {
+			_ = pods.Delete(ctx, created.Name, metav1.DeleteOptions{})
+			created = nil
+		}
+		p, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		created = p
+		return waitForPodRunning(ctx, pods, created.Name)
+	})
+	if created != nil {
+		// Cleanup runs even if ctx is already done, so a caller that cancels
+		// doesn't leave the Pod behind - use a fresh background context here.
+		defer func() {
+			_ = pods.Delete(context.Background(), created.Name, metav1.DeleteOptions{})
+		}()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err = retryWithBackoff(ctx, nativeKubernetesBackoff, func() error {
+		stdout.Reset()
+		stderr.Reset()
+		return attach(ctx, cfg, clientset, namespace, created.Name, in, stdout, stderr)
+	})
+	if err != nil {
+		return nil, errors.Wrap(fmt.Errorf("%s: %w", stderr.String(), err))
+	}
+
+	return (&kio.ByteReader{Reader: stdout}).Read()
+}
+
+// functionContainerName is the name kustomize looks for when injecting the
+// function container's exec-critical fields into a user-supplied PodTemplate.
+const functionContainerName = "krm-function"
+
+// buildPod builds the Pod to run the function container in, merging the
+// function container (image, stdin, env, volumeMounts derived from
+// StorageMounts) into PodTemplate if one is set, or building a minimal Pod
+// from scratch otherwise.
+func (c *Filter) buildPod() (*corev1.Pod, error) {
+	fnContainer, volumes := c.functionContainer()
+
+	if c.PodTemplate == "" {
+		podName := strings.Split(path.Base(c.Image), ":")[0]
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: podName + "-"},
+			Spec: corev1.PodSpec{
+				RestartPolicy:      corev1.RestartPolicyNever,
+				HostNetwork:        c.ContainerSpec.Network,
+				ServiceAccountName: c.ServiceAccountName,
+				NodeSelector:       c.NodeSelector,
+				ImagePullSecrets:   c.imagePullSecretRefs(),
+				SecurityContext:    c.podSecurityContext(),
+				Containers:         []corev1.Container{fnContainer},
+				Volumes:            volumes,
+			},
+		}, nil
+	}
+
+	pod, err := c.loadPodTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if pod.Name == "" && pod.GenerateName == "" {
+		pod.GenerateName = strings.Split(path.Base(c.Image), ":")[0] + "-"
+	}
+	if pod.Spec.RestartPolicy != "" && pod.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		return nil, errors.Errorf("PodTemplate must not set restartPolicy != Never, got %q", pod.Spec.RestartPolicy)
+	}
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = c.podSecurityContext()
+	}
+	// Mirror the no-template branch for the other kustomize-managed pod-level
+	// fields: fill in what the template left unset rather than silently
+	// dropping them, and union (rather than replace) ImagePullSecrets since
+	// the template may already reference its own.
+	if pod.Spec.ServiceAccountName == "" {
+		pod.Spec.ServiceAccountName = c.ServiceAccountName
+	}
+	if pod.Spec.NodeSelector == nil {
+		pod.Spec.NodeSelector = c.NodeSelector
+	}
+	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, c.imagePullSecretRefs()...)
+
+	index := -1
+	for i, container := range pod.Spec.Containers {
+		if container.Name == functionContainerName {
+			if index != -1 {
+				return nil, errors.Errorf("PodTemplate must contain exactly one container named %q", functionContainerName)
+			}
+			index = i
 		}
 	}
+	if index == -1 {
+		return nil, errors.Errorf("PodTemplate must contain exactly one container named %q", functionContainerName)
+	}
 
-	// Define volumes and volume mounts
-	volumes := []map[string]interface{}{}
-	volumeMounts := []map[string]interface{}{}
+	// merge the exec-critical fields into the user's container, letting the
+	// template own everything else (resources, probes, ...): Image, Stdin and
+	// StdinOnce replace the template's values, and Env and VolumeMounts are
+	// appended after the template's entries (entries with the same name are
+	// not combined).
+	merged := pod.Spec.Containers[index]
+	merged.Image = fnContainer.Image
+	merged.Stdin = fnContainer.Stdin
+	merged.StdinOnce = fnContainer.StdinOnce
+	merged.Env = append(merged.Env, fnContainer.Env...)
+	merged.VolumeMounts = append(merged.VolumeMounts, fnContainer.VolumeMounts...)
+	if merged.SecurityContext == nil {
+		merged.SecurityContext = fnContainer.SecurityContext
+	}
+	pod.Spec.Containers[index] = merged
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
+
+	return pod, nil
+}
 
+// loadPodTemplate parses PodTemplate, which may be an inline Pod YAML
+// manifest or a path to one, analogous to `podman play kube`.
+func (c *Filter) loadPodTemplate() (*corev1.Pod, error) {
+	manifest := []byte(c.PodTemplate)
+	if !strings.Contains(c.PodTemplate, "\n") {
+		if contents, err := os.ReadFile(c.PodTemplate); err == nil {
+			manifest = contents
+		}
+	}
+
+	pod := &corev1.Pod{}
+	if err := k8syaml.Unmarshal(manifest, pod); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return pod, nil
+}
+
+// functionContainer returns the container + volumes kustomize owns: the
+// function image, its stdin wiring, env, and StorageMounts-derived volumes.
+func (c *Filter) functionContainer() (corev1.Container, []corev1.Volume) {
+	var envs []corev1.EnvVar
+	for k, v := range runtimeutil.NewContainerEnvFromStringSlice(c.Env).EnvVars {
+		envs = append(envs, corev1.EnvVar{Name: k, Value: v})
+	}
+
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
 	for _, storageMount := range c.StorageMounts {
-		// Convert declarative relative paths to absolute
 		absPath := storageMount.Src
 		if !filepath.IsAbs(storageMount.Src) {
 			absPath = filepath.Join(c.Exec.WorkingDir, storageMount.Src)
 		}
 
-		// Generate a unique volume name based on the storage mount
 		volumeHash := sha256.Sum256([]byte(storageMount.String()))
 		volumeName := hex.EncodeToString(volumeHash[:])[:32]
 
+		volume := corev1.Volume{Name: volumeName}
 		switch storageMount.MountType {
 		case "bind":
-			volumes = append(volumes, map[string]interface{}{
-				"name": volumeName,
-				"hostPath": map[string]interface{}{
-					"path": absPath,
-				},
-			})
+			volume.HostPath = &corev1.HostPathVolumeSource{Path: absPath}
 		case "tmpfs":
-			volumes = append(volumes, map[string]interface{}{
-				"name": volumeName,
-				"emptyDir": map[string]interface{}{
-					"medium": "Memory",
-				},
-			})
+			volume.EmptyDir = &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}
 		case "volume":
-			volumes = append(volumes, map[string]interface{}{
-				"name": volumeName,
-				"persistentVolumeClaim": map[string]interface{}{
-					"claimName": storageMount.Src,
-				},
-			})
+			volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: storageMount.Src}
 		default:
 			continue
 		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: volumeName, MountPath: storageMount.DstPath})
+	}
 
-		volumeMounts = append(volumeMounts, map[string]interface{}{
-			"name":      volumeName,
-			"mountPath": storageMount.DstPath,
-		})
+	pullPolicy := c.PullPolicy
+	if c.Offline {
+		pullPolicy = string(corev1.PullNever)
 	}
 
-	// Convert volumes and volume mounts to JSON
-	volumesJSON, _ := json.Marshal(volumes)
-	volumeMountsJSON, _ := json.Marshal(volumeMounts)
+	privileged := false
+	allowPrivilegeEscalation := false
 
-	// Base kubectl run command
-	args := []string{"run", podName,
-		"--rm", "--stdin", "--quiet", // Automatically remove the pod, attach stdin, and suppress output
-		"--image", c.Image, // Specify the container image
-		"--restart=Never", // Do not restart the pod
-		"--overrides", fmt.Sprintf(`{
-		"apiVersion": "v1",
-		"spec": {
-			"containers": [{
-				"name": "krm-function",
-				"image": "%s",
-				"stdin": true,
-				"stdinOnce": true,
-				"env": %s,
-				"volumeMounts": %s
-			}],
-			"securityContext": {
-				"runAsUser": %s,
-				"runAsGroup": %s,
-				"privileged": false,
-				"allowPrivilegeEscalation": false
-			},
-			"hostNetwork": %t,
-			"volumes": %s
+	return corev1.Container{
+		Name:            functionContainerName,
+		Image:           c.Image,
+		Stdin:           true,
+		StdinOnce:       true,
+		Env:             envs,
+		VolumeMounts:    volumeMounts,
+		ImagePullPolicy: corev1.PullPolicy(pullPolicy),
+		SecurityContext: &corev1.SecurityContext{
+			Privileged:               &privileged,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		},
+	}, volumes
+}
+
+// podSecurityContext derives the Pod-level runAsUser/runAsGroup from
+// UIDGID, defaulting to 65534 (nobody) the same way the docker/podman
+// drivers' --user flag does.
+func (c *Filter) podSecurityContext() *corev1.PodSecurityContext {
+	uid, gid := int64(65534), int64(65534)
+	if c.UIDGID != "" && c.UIDGID != "nobody" {
+		if parts := strings.Split(c.UIDGID, ":"); len(parts) == 2 {
+			if v, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+				uid = v
+			}
+			if v, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				gid = v
+			}
 		}
-	}`, c.Image, envsJSON, volumeMountsJSON, uid, gid, c.ContainerSpec.Network, volumesJSON),
 	}
+	return &corev1.PodSecurityContext{RunAsUser: &uid, RunAsGroup: &gid}
+}
 
-	return "kubectl", args
+// imagePullSecretRefs converts ImagePullSecrets to the typed references a
+// PodSpec expects.
+func (c *Filter) imagePullSecretRefs() []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	for _, s := range c.ImagePullSecrets {
+		refs = append(refs, corev1.LocalObjectReference{Name: s})
+	}
+	return refs
+}
+
+// ensureImagePullSecret creates (or reuses) a dockerconfigjson Secret from
+// DockerConfigPath when ImagePullSecrets is empty, so registry credentials
+// can be supplied as a local file rather than a pre-existing cluster
+// secret. Returns the secret name to reference from the Pod, or "" if
+// DockerConfigPath isn't set or an explicit ImagePullSecrets was given.
+func (c *Filter) ensureImagePullSecret(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	if c.DockerConfigPath == "" || len(c.ImagePullSecrets) > 0 {
+		return "", nil
+	}
+
+	contents, err := os.ReadFile(c.DockerConfigPath)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	hash := sha256.Sum256(contents)
+	name := "kustomize-fn-pull-" + hex.EncodeToString(hash[:])[:16]
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: contents},
+	}
+	_, err = clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", errors.Wrap(err)
+	}
+	return name, nil
+}
+
+// waitForPodRunning polls the Pod until it reaches Running phase, returning
+// an error (which retryWithBackoff retries like any other) if it instead
+// enters a backoff state such as ImagePullBackOff. It returns ctx.Err() if
+// ctx is cancelled before the Pod reaches a terminal state.
+func waitForPodRunning(ctx context.Context, pods corev1client, name string) error {
+	for {
+		p, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		switch p.Status.Phase {
+		case corev1.PodRunning:
+			return nil
+		case corev1.PodFailed:
+			return errors.Errorf("pod %s failed: %s", name, p.Status.Reason)
+		}
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.State.Waiting == nil {
+				continue
+			}
+			switch cs.State.Waiting.Reason {
+			case "ImagePullBackOff", "ErrImageNeverPull", "ErrImagePull":
+				return errors.Errorf("pod %s: %s", name, cs.State.Waiting.Reason)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// attach streams stdin to the function container and copies its stdout and
+// stderr into the given buffers using the pod exec/attach subresource.
+func attach(ctx context.Context, cfg *rest.Config, clientset kubernetes.Interface, namespace, name string, stdin, stdout, stderr *bytes.Buffer) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(name).
+		Namespace(namespace).
+		SubResource("attach")
+	req.VersionedParams(&corev1.PodAttachOptions{
+		Container: "krm-function",
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+// retryWithBackoff retries fn with exponential backoff until it succeeds,
+// ctx is cancelled, or deadline elapses, returning the last error.
+func retryWithBackoff(ctx context.Context, deadline time.Duration, fn func() error) error {
+	backoff := 500 * time.Millisecond
+	start := time.Now()
+	var err error
+	for time.Since(start) < deadline {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// corev1client is the subset of the typed Pod client used by the native
+// executor, narrowed so waitForPodRunning is easy to exercise with a fake.
+type corev1client interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Pod, error)
 }
 
 // NewContainer returns a new container filter
 func NewContainer(spec runtimeutil.ContainerSpec, uidgid string) Filter {
-	f := Filter{ContainerSpec: spec, UIDGID: uidgid}
-
-	return f
+	return Filter{ClientV1Alpha1: ClientV1Alpha1{ContainerSpec: spec, UIDGID: uidgid}}
 }
@@ -0,0 +1,385 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/runtime/runtimeutil"
+)
+
+func TestGetDockerCommand(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		UIDGID:        "1000:1000",
+	}}
+
+	bin, args := f.getDockerCommand()
+	if bin != "docker" {
+		t.Fatalf("got bin %q, want docker", bin)
+	}
+	if args[len(args)-1] != "example.com/fn:v1" {
+		t.Fatalf("image must be the last arg, got %v", args)
+	}
+	if !containsArgPair(args, "--user", "1000:1000") {
+		t.Fatalf("args missing --user 1000:1000: %v", args)
+	}
+	if !contains(args, "--security-opt=no-new-privileges") {
+		t.Fatalf("args missing no-new-privileges: %v", args)
+	}
+}
+
+func TestGetPodmanCommand(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		UIDGID:        "nobody",
+	}}
+
+	bin, args := f.getPodmanCommand()
+	if bin != "podman" {
+		t.Fatalf("got bin %q, want podman", bin)
+	}
+	if !contains(args, "--userns=keep-id") {
+		t.Fatalf("UIDGID=nobody must add --userns=keep-id, got %v", args)
+	}
+	if args[len(args)-1] != "example.com/fn:v1" {
+		t.Fatalf("image must be the last arg, got %v", args)
+	}
+}
+
+func TestGetPodmanCommand_ReadOnlyMount(t *testing.T) {
+	mount := runtimeutil.StorageMount{MountType: "bind", Src: "/abs/src", DstPath: "/dst", ReadWriteMode: false}
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1", StorageMounts: []runtimeutil.StorageMount{mount}},
+	}}
+
+	_, args := f.getPodmanCommand()
+	if !contains(args, mount.String()) {
+		t.Fatalf("expected podman to reuse StorageMount.String() (honoring ReadWriteMode), got %v", args)
+	}
+	if !containsSubstring(args, "readonly") {
+		t.Fatalf("read-only mount must be reflected in the podman --mount flag, got %v", args)
+	}
+}
+
+func TestBuildPod_NoTemplate(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		UIDGID:        "1000:1000",
+	}}
+
+	pod, err := f.buildPod()
+	if err != nil {
+		t.Fatalf("buildPod: %v", err)
+	}
+	if pod.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Fatalf("got RestartPolicy %q, want Never", pod.Spec.RestartPolicy)
+	}
+	if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Name != functionContainerName {
+		t.Fatalf("expected a single %q container, got %+v", functionContainerName, pod.Spec.Containers)
+	}
+	if pod.Spec.SecurityContext == nil || *pod.Spec.SecurityContext.RunAsUser != 1000 {
+		t.Fatalf("expected PodSecurityContext.RunAsUser 1000 derived from UIDGID, got %+v", pod.Spec.SecurityContext)
+	}
+}
+
+func TestGetKubernetesCommand_Namespace(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		Namespace:     "my-ns",
+	}}
+
+	_, args := f.getKubernetesCommand()
+	if !containsArgPair(args, "--namespace", "my-ns") {
+		t.Fatalf("expected --namespace my-ns so the pod lands where the pull secret was created, got %v", args)
+	}
+}
+
+func TestGetKubernetesCommand_NoNamespace(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+	}}
+
+	_, args := f.getKubernetesCommand()
+	if contains(args, "--namespace") {
+		t.Fatalf("expected no --namespace flag when Namespace is unset, got %v", args)
+	}
+}
+
+func TestBuildPod_RelativeStorageMountResolvesAgainstWorkingDir(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{
+			Image:         "example.com/fn:v1",
+			StorageMounts: []runtimeutil.StorageMount{{MountType: "bind", Src: "relative/src", DstPath: "/dst"}},
+		},
+	}}
+	// filterNative bypasses runExec, so it's responsible for populating
+	// Exec.WorkingDir itself before buildPod resolves relative mounts
+	// against it - set it here the same way filterNative now does.
+	f.Exec.WorkingDir = "/home/user/project"
+
+	pod, err := f.buildPod()
+	if err != nil {
+		t.Fatalf("buildPod: %v", err)
+	}
+	if len(pod.Spec.Volumes) != 1 {
+		t.Fatalf("expected 1 volume, got %+v", pod.Spec.Volumes)
+	}
+	want := filepath.Join("/home/user/project", "relative/src")
+	if pod.Spec.Volumes[0].HostPath == nil || pod.Spec.Volumes[0].HostPath.Path != want {
+		t.Fatalf("got HostPath %+v, want %q", pod.Spec.Volumes[0].HostPath, want)
+	}
+}
+
+func TestBuildPod_Template_Valid(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		PodTemplate: `
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: krm-function
+    resources:
+      limits:
+        memory: 256Mi
+`,
+	}}
+
+	pod, err := f.buildPod()
+	if err != nil {
+		t.Fatalf("buildPod: %v", err)
+	}
+	if len(pod.Spec.Containers) != 1 {
+		t.Fatalf("expected exactly 1 container, got %d", len(pod.Spec.Containers))
+	}
+	c := pod.Spec.Containers[0]
+	if c.Image != "example.com/fn:v1" {
+		t.Fatalf("got merged Image %q, want example.com/fn:v1", c.Image)
+	}
+	if !c.Stdin || !c.StdinOnce {
+		t.Fatalf("expected Stdin/StdinOnce merged in, got %+v", c)
+	}
+	if c.Resources.Limits.Memory().String() != "256Mi" {
+		t.Fatalf("expected the template's resources to be preserved, got %+v", c.Resources)
+	}
+}
+
+func TestBuildPod_Template_MergesPodLevelFields(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		ContainerSpec:      runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+		ServiceAccountName: "fn-runner",
+		NodeSelector:       map[string]string{"disk": "ssd"},
+		ImagePullSecrets:   []string{"from-field"},
+		PodTemplate: `
+apiVersion: v1
+kind: Pod
+spec:
+  imagePullSecrets:
+  - name: from-template
+  containers:
+  - name: krm-function
+`,
+	}}
+
+	pod, err := f.buildPod()
+	if err != nil {
+		t.Fatalf("buildPod: %v", err)
+	}
+	if pod.Spec.ServiceAccountName != "fn-runner" {
+		t.Fatalf("got ServiceAccountName %q, want it filled in from ClientV1Alpha1", pod.Spec.ServiceAccountName)
+	}
+	if pod.Spec.NodeSelector["disk"] != "ssd" {
+		t.Fatalf("got NodeSelector %+v, want it filled in from ClientV1Alpha1", pod.Spec.NodeSelector)
+	}
+	var names []string
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		names = append(names, ref.Name)
+	}
+	if !contains(names, "from-template") || !contains(names, "from-field") {
+		t.Fatalf("expected ImagePullSecrets to union template and field values, got %v", names)
+	}
+}
+
+func TestBuildPod_Template_MissingFunctionContainer(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		PodTemplate: `
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: sidecar
+`,
+	}}
+
+	if _, err := f.buildPod(); err == nil || !strings.Contains(err.Error(), functionContainerName) {
+		t.Fatalf("expected an error naming %q, got %v", functionContainerName, err)
+	}
+}
+
+func TestBuildPod_Template_DuplicateFunctionContainer(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		PodTemplate: `
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: krm-function
+  - name: krm-function
+`,
+	}}
+
+	if _, err := f.buildPod(); err == nil || !strings.Contains(err.Error(), "exactly one container") {
+		t.Fatalf("expected an 'exactly one container' error, got %v", err)
+	}
+}
+
+func TestBuildPod_Template_InvalidRestartPolicy(t *testing.T) {
+	f := &Filter{ClientV1Alpha1: ClientV1Alpha1{
+		PodTemplate: `
+apiVersion: v1
+kind: Pod
+spec:
+  restartPolicy: Always
+  containers:
+  - name: krm-function
+`,
+	}}
+
+	if _, err := f.buildPod(); err == nil || !strings.Contains(err.Error(), "restartPolicy") {
+		t.Fatalf("expected a restartPolicy error, got %v", err)
+	}
+}
+
+// fakePods is a minimal corev1client fake that hands back queued responses,
+// so waitForPodRunning can be exercised without a real API server.
+type fakePods struct {
+	pods []*corev1.Pod
+	errs []error
+	i    int
+}
+
+func (f *fakePods) Get(_ context.Context, _ string, _ metav1.GetOptions) (*corev1.Pod, error) {
+	if f.i >= len(f.pods) {
+		f.i = len(f.pods) - 1
+	}
+	p, err := f.pods[f.i], f.errs[f.i]
+	f.i++
+	return p, err
+}
+
+func TestWaitForPodRunning(t *testing.T) {
+	running := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+	failed := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}}
+	backoff := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}}}}
+
+	cases := []struct {
+		name    string
+		pods    *fakePods
+		wantErr string
+	}{
+		{"running", &fakePods{pods: []*corev1.Pod{running}, errs: []error{nil}}, ""},
+		{"failed", &fakePods{pods: []*corev1.Pod{failed}, errs: []error{nil}}, "failed"},
+		{"image pull backoff", &fakePods{pods: []*corev1.Pod{backoff}, errs: []error{nil}}, "ImagePullBackOff"},
+		{"get error", &fakePods{pods: []*corev1.Pod{nil}, errs: []error{apierrors.NewNotFound(corev1.Resource("pods"), "x")}}, "not found"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := waitForPodRunning(context.Background(), tc.pods, "x")
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForPodRunning_CtxCancelled(t *testing.T) {
+	pending := &corev1.Pod{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := waitForPodRunning(ctx, &fakePods{pods: []*corev1.Pod{pending}, errs: []error{nil}}, "x")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryWithBackoff_SucceedsEventually(t *testing.T) {
+	attempts := 0
+	err := retryWithBackoff(context.Background(), time.Second, func() error {
+		attempts++
+		if attempts < 2 {
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retryWithBackoff: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", attempts)
+	}
+}
+
+func TestRetryWithBackoff_CtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := retryWithBackoff(ctx, time.Second, func() error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if calls != 0 {
+		t.Fatalf("fn must not run once ctx is already cancelled, got %d calls", calls)
+	}
+}
+
+func contains(args []string, want string) bool {
+	for _, a := range args {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func containsArgPair(args []string, flag, value string) bool {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag && args[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSubstring(args []string, substr string) bool {
+	for _, a := range args {
+		if strings.Contains(a, substr) {
+			return true
+		}
+	}
+	return false
+}
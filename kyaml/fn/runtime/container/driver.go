@@ -0,0 +1,138 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ContainerDriver runs a function container and returns the Resources it
+// writes to stdout. Built-in drivers are registered under the docker,
+// podman, kubectl-shell, and kubernetes-native names; external packages can
+// register their own (e.g. a nerdctl or containerd-shim driver) via
+// RegisterDriver.
+type ContainerDriver interface {
+	// Name returns the name the driver is registered under.
+	Name() string
+
+	// Validate returns an error if spec cannot be run by this driver.
+	Validate(spec ClientV1Alpha1) error
+
+	// Run executes the function container described by spec, streaming
+	// stdin to it, and returns the Resources it writes to stdout.
+	Run(ctx context.Context, spec ClientV1Alpha1, stdin []*yaml.RNode) ([]*yaml.RNode, error)
+}
+
+var driverRegistry = map[string]func() ContainerDriver{
+	string(DriverDocker): func() ContainerDriver { return &dockerDriver{} },
+	string(DriverPodman): func() ContainerDriver { return &podmanDriver{} },
+	"kubectl-shell":      func() ContainerDriver { return &kubectlShellDriver{} },
+	"kubernetes-native":  func() ContainerDriver { return &kubernetesNativeDriver{} },
+}
+
+// RegisterDriver registers a ContainerDriver factory under name, making it
+// selectable via ClientV1Alpha1.Driver / Filter.Driver.
+func RegisterDriver(name string, factory func() ContainerDriver) {
+	driverRegistry[name] = factory
+}
+
+func lookupDriver(name string) (ContainerDriver, error) {
+	factory, found := driverRegistry[name]
+	if !found {
+		return nil, errors.Errorf("unknown container driver %q", name)
+	}
+	return factory(), nil
+}
+
+// dockerDriver runs the function container with the docker CLI.
+type dockerDriver struct{}
+
+func (*dockerDriver) Name() string                  { return string(DriverDocker) }
+func (*dockerDriver) Validate(ClientV1Alpha1) error { return nil }
+func (*dockerDriver) Run(ctx context.Context, spec ClientV1Alpha1, stdin []*yaml.RNode) ([]*yaml.RNode, error) {
+	f := Filter{ClientV1Alpha1: spec}
+	if err := f.ensureImage(ctx, "docker"); err != nil {
+		return nil, err
+	}
+	return f.runExec(f.getDockerCommand, stdin)
+}
+
+// podmanDriver runs the function container with the podman CLI.
+type podmanDriver struct{}
+
+func (*podmanDriver) Name() string                  { return string(DriverPodman) }
+func (*podmanDriver) Validate(ClientV1Alpha1) error { return nil }
+func (*podmanDriver) Run(ctx context.Context, spec ClientV1Alpha1, stdin []*yaml.RNode) ([]*yaml.RNode, error) {
+	f := Filter{ClientV1Alpha1: spec}
+	if err := f.ensureImage(ctx, "podman"); err != nil {
+		return nil, err
+	}
+	return f.runExec(f.getPodmanCommand, stdin)
+}
+
+// kubectlShellDriver runs the function container as a Pod via `kubectl run`.
+type kubectlShellDriver struct{}
+
+func (*kubectlShellDriver) Name() string { return "kubectl-shell" }
+func (*kubectlShellDriver) Validate(spec ClientV1Alpha1) error {
+	f := Filter{ClientV1Alpha1: spec}
+	_, err := f.buildPod()
+	return err
+}
+func (*kubectlShellDriver) Run(ctx context.Context, spec ClientV1Alpha1, stdin []*yaml.RNode) ([]*yaml.RNode, error) {
+	f := Filter{ClientV1Alpha1: spec}
+	f.addAutoImagePullSecret(ctx)
+	return f.runExec(f.getKubernetesCommand, stdin)
+}
+
+// addAutoImagePullSecret mirrors the kubernetes-native driver's
+// DockerConfigPath handling: best-effort, since kubectl-shell has no
+// client-go connection of its own to create the Secret with - if no
+// kubeconfig / in-cluster config is reachable, DockerConfigPath is left for
+// the user to wire up via ImagePullSecrets themselves.
+func (c *Filter) addAutoImagePullSecret(ctx context.Context) {
+	if c.DockerConfigPath == "" || len(c.ImagePullSecrets) > 0 {
+		return
+	}
+	cfg, err := nativeKubernetesConfig()
+	if err != nil {
+		return
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	if name, err := c.ensureImagePullSecret(ctx, clientset, namespace); err == nil && name != "" {
+		c.ImagePullSecrets = append(c.ImagePullSecrets, name)
+		c.Namespace = namespace
+	}
+}
+
+// kubernetesNativeDriver runs the function container as a Pod using
+// client-go directly, without shelling out to kubectl.
+type kubernetesNativeDriver struct{}
+
+func (*kubernetesNativeDriver) Name() string { return "kubernetes-native" }
+func (*kubernetesNativeDriver) Validate(spec ClientV1Alpha1) error {
+	f := Filter{ClientV1Alpha1: spec}
+	_, err := f.buildPod()
+	return err
+}
+func (*kubernetesNativeDriver) Run(ctx context.Context, spec ClientV1Alpha1, stdin []*yaml.RNode) ([]*yaml.RNode, error) {
+	cfg, err := nativeKubernetesConfig()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	f := Filter{ClientV1Alpha1: spec}
+	return f.filterNative(ctx, cfg, stdin)
+}
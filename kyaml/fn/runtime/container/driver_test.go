@@ -0,0 +1,121 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/runtime/runtimeutil"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestDriverRegistry_BuiltinNames(t *testing.T) {
+	for _, name := range []string{string(DriverDocker), string(DriverPodman), "kubectl-shell", "kubernetes-native"} {
+		if _, err := lookupDriver(name); err != nil {
+			t.Fatalf("lookupDriver(%q): %v", name, err)
+		}
+	}
+}
+
+func TestLookupDriver_Unknown(t *testing.T) {
+	if _, err := lookupDriver("no-such-driver"); err == nil {
+		t.Fatalf("expected an error for an unregistered driver name")
+	}
+}
+
+func TestRegisterDriver(t *testing.T) {
+	RegisterDriver("fake-for-test", func() ContainerDriver { return &dockerDriver{} })
+	d, err := lookupDriver("fake-for-test")
+	if err != nil {
+		t.Fatalf("lookupDriver after RegisterDriver: %v", err)
+	}
+	if d.Name() != string(DriverDocker) {
+		t.Fatalf("got %q, want the registered factory's driver", d.Name())
+	}
+}
+
+func TestDriverName(t *testing.T) {
+	unreachableKubeconfig := filepath.Join(t.TempDir(), "does-not-exist")
+	t.Setenv("KUBECONFIG", unreachableKubeconfig)
+
+	cases := []struct {
+		name string
+		spec ClientV1Alpha1
+		want string
+	}{
+		{"defaults to docker", ClientV1Alpha1{}, string(DriverDocker)},
+		{"explicit driver passes through", ClientV1Alpha1{Driver: DriverPodman}, string(DriverPodman)},
+		{"DriverKubectl falls back to kubectl-shell without a reachable config",
+			ClientV1Alpha1{Driver: DriverKubectl}, "kubectl-shell"},
+		{"EnableKubernetes falls back to kubectl-shell without a reachable config",
+			ClientV1Alpha1{ContainerSpec: runtimeutil.ContainerSpec{EnableKubernetes: true}}, "kubectl-shell"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &Filter{ClientV1Alpha1: tc.spec}
+			if got := f.driverName(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// writeFakeExec writes an executable named bin to a fresh directory that
+// succeeds "image inspect" (pretending the image is already present, so
+// ensureImage never tries to pull) and otherwise echoes stdin back to
+// stdout unchanged, round-tripping whatever the real runtimeexec.Filter
+// wraps the Resources in.
+func writeFakeExec(t *testing.T, bin string) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = image ] && [ \"$2\" = inspect ]; then exit 0; fi\ncat\n"
+	path := filepath.Join(dir, bin)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake %s: %v", bin, err)
+	}
+	return dir
+}
+
+func withFakeExecOnPath(t *testing.T, bin string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake exec script is a POSIX shell script")
+	}
+	dir := writeFakeExec(t, bin)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDockerDriver_Run(t *testing.T) {
+	withFakeExecOnPath(t, "docker")
+
+	node := yaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	out, err := (&dockerDriver{}).Run(context.Background(), ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+	}, []*yaml.RNode{node})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected the fake exec to echo the single input Resource back, got %d", len(out))
+	}
+}
+
+func TestPodmanDriver_Run(t *testing.T) {
+	withFakeExecOnPath(t, "podman")
+
+	node := yaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	out, err := (&podmanDriver{}).Run(context.Background(), ClientV1Alpha1{
+		ContainerSpec: runtimeutil.ContainerSpec{Image: "example.com/fn:v1"},
+	}, []*yaml.RNode{node})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected the fake exec to echo the single input Resource back, got %d", len(out))
+	}
+}